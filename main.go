@@ -6,6 +6,14 @@
 // Beyond verifying that the format of the data is correct, the script will also compare
 // the corrections against a given MMDB, reporting on how many corrections differ from
 // the contents in the database.
+// -gf also accepts an http(s):// URL, in which case the geofeed is downloaded following
+// RFC 8805 section 3.3 (conditional requests via -cache, detached signatures via -verify-sig).
+// -rdap cross-checks each prefix's RDAP registration for a matching geofeed= remark, since
+// MaxMind won't honor a correction that the prefix's RIR record doesn't authorize.
+// MMDB lookups run concurrently across -workers goroutines; pass -progress to report
+// throughput to stderr while a large feed is processed.
+// -emit-patch writes the disagreeing rows as an MMDB-backed correction patch, plus a
+// companion file of prefixes that already agree and so need no correction.
 package main
 
 import (
@@ -13,22 +21,44 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"net/http"
 	"os"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/maxmind/mm-geofeed-verifier/verify"
 )
 
 const version = "2.2.1"
 
+// outputFormats are the valid values for -format.
+var outputFormats = map[string]bool{
+	"text": true,
+	"json": true,
+	"csv":  true,
+}
+
 type config struct {
-	gf      string
-	db      string
-	isp     string
-	version bool
-	laxMode bool
+	gf        string
+	db        string
+	isp       string
+	asn       string
+	format    string
+	out       string
+	cache     string
+	verifySig string
+	maxBytes  int64
+	rdap      bool
+	rdapCache string
+	rdapTTL   time.Duration
+	workers   int
+	progress  bool
+	emitPatch string
+	version   bool
+	laxMode   bool
 }
 
 func main() {
@@ -45,34 +75,109 @@ func run() error {
 		return err
 	}
 
-	c, diffLines, asnCounts, err := verify.ProcessGeofeed(conf.gf, conf.db, conf.isp, conf.laxMode)
+	gfPath, lastModified, cleanupGeofeed, err := resolveGeofeed(conf)
+	if err != nil {
+		return fmt.Errorf("unable to fetch geofeed %s: %w", conf.gf, err)
+	}
+	defer cleanupGeofeed()
+	if !lastModified.IsZero() {
+		log.Printf("geofeed last modified: %s", lastModified.Format(http.TimeFormat))
+	}
+
+	var progress io.Writer
+	if conf.progress {
+		progress = os.Stderr
+	}
+	c, diffs, asnCounts, err := verify.ProcessGeofeed(gfPath, conf.db, conf.isp, conf.asn, verify.Options{
+		LaxMode:  conf.laxMode,
+		Workers:  conf.workers,
+		Progress: progress,
+	})
 	if err != nil {
 		return fmt.Errorf("unable to process geofeed %s: %w", conf.gf, err)
 	}
 
-	fmt.Printf(
-		strings.Join(diffLines, "\n\n")+
-			"\n\nOut of %d potential corrections, %d may be different than our current mappings\n\n",
-		c.Total,
-		c.Differences,
-	)
+	w := os.Stdout
+	if conf.out != "" {
+		f, err := os.Create(conf.out)
+		if err != nil {
+			return fmt.Errorf("creating %s: %w", conf.out, err)
+		}
+		defer f.Close()
+		w = f
+	}
 
-	// https://stackoverflow.com/a/56706305
-	asNumbers := make([]uint, 0, len(asnCounts))
-	for asNumber := range asnCounts {
-		asNumbers = append(asNumbers, asNumber)
+	// -rdap and -emit-patch both need every prefix in the geofeed, in file
+	// order. Read it at most once and reuse it, rather than re-reading (or,
+	// for a URL -gf, re-fetching) the same file for each.
+	var allPrefixes []string
+	if conf.rdap || conf.emitPatch != "" {
+		allPrefixes, err = verify.ReadPrefixes(gfPath)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", gfPath, err)
+		}
 	}
-	sort.Slice(
-		asNumbers,
-		func(i, j int) bool {
-			return asnCounts[asNumbers[i]] > asnCounts[asNumbers[j]]
-		},
-	)
-	for _, asNumber := range asNumbers {
-		fmt.Printf("ASN: %d, count: %d\n", asNumber, asnCounts[asNumber])
+
+	var rdapFindings []verify.RDAPFinding
+	if conf.rdap {
+		rdapFindings, err = verify.CheckGeofeedAuthorization(allPrefixes, conf.gf, verify.RDAPOptions{
+			CacheDir: conf.rdapCache,
+			TTL:      conf.rdapTTL,
+		})
+		if err != nil {
+			return fmt.Errorf("checking RDAP authorization: %w", err)
+		}
 	}
 
-	return nil
+	if conf.emitPatch != "" {
+		if err := emitPatch(conf.emitPatch, diffs, allPrefixes); err != nil {
+			return err
+		}
+	}
+
+	render, ok := renderers[conf.format]
+	if !ok {
+		return fmt.Errorf("unknown -format %q", conf.format)
+	}
+
+	return render(w, c, diffs, sortedASNCounts(asnCounts), rdapFindings)
+}
+
+// resolveGeofeed makes conf.gf available as a local file path, downloading
+// it once if it names an http(s):// URL, so callers that need more than one
+// pass over the geofeed (diffing, -rdap, -emit-patch) all see the same
+// content instead of each triggering its own fetch. lastModified is the
+// zero time when -gf is local or the server didn't report one. The caller
+// must invoke the returned cleanup func once done with the path.
+func resolveGeofeed(conf *config) (string, time.Time, func(), error) {
+	if !strings.HasPrefix(conf.gf, "http://") && !strings.HasPrefix(conf.gf, "https://") {
+		return conf.gf, time.Time{}, func() {}, nil
+	}
+	return verify.FetchToFile(conf.gf, verify.FetchOptions{
+		CacheDir: conf.cache,
+		Keyring:  conf.verifySig,
+		MaxBytes: conf.maxBytes,
+	})
+}
+
+// asnCount pairs an ASN with how many geofeed rows it was seen under, kept
+// together so renderers can report them in descending order of count.
+type asnCount struct {
+	ASN   uint
+	Count int
+}
+
+// sortedASNCounts orders asnCounts by count, descending. The order of ASNs
+// with equal counts is not defined.
+func sortedASNCounts(asnCounts map[uint]int) []asnCount {
+	counts := make([]asnCount, 0, len(asnCounts))
+	for asn, count := range asnCounts {
+		counts = append(counts, asnCount{ASN: asn, Count: count})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		return counts[i].Count > counts[j].Count
+	})
+	return counts
 }
 
 func parseFlags(program string, args []string) (c *config, output string, err error) {
@@ -83,12 +188,71 @@ func parseFlags(program string, args []string) (c *config, output string, err er
 	var conf config
 	flags.StringVar(&conf.gf, "gf", "", "Path to local geofeed file to verify")
 	flags.StringVar(&conf.isp, "isp", "", "Path to ISP MMDB file (optional)")
+	flags.StringVar(&conf.asn, "asn", "", "Path to GeoLite2-ASN MMDB file (optional, alternative to -isp)")
 	flags.StringVar(
 		&conf.db,
 		"db",
 		"/usr/local/share/GeoIP/GeoIP2-City.mmdb",
 		"Path to MMDB file to compare geofeed file against",
 	)
+	flags.StringVar(&conf.format, "format", "text", "Output format: text, json, or csv")
+	flags.StringVar(&conf.out, "o", "", "Path to write output to (default stdout)")
+	flags.StringVar(
+		&conf.cache,
+		"cache",
+		"",
+		"Directory to cache a -gf URL download in, reused via If-Modified-Since/ETag (optional)",
+	)
+	flags.StringVar(
+		&conf.verifySig,
+		"verify-sig",
+		"",
+		"Path to an armored OpenPGP keyring used to verify a -gf URL's detached .asc signature (optional)",
+	)
+	flags.Int64Var(
+		&conf.maxBytes,
+		"max-size",
+		0,
+		"Maximum bytes to download for a -gf URL (default 100MiB)",
+	)
+	flags.BoolVar(
+		&conf.rdap,
+		"rdap",
+		false,
+		"Cross-check every prefix against its RDAP registration's geofeed= remark (-gf must be a URL)",
+	)
+	flags.StringVar(
+		&conf.rdapCache,
+		"rdap-cache",
+		"",
+		"Directory to cache IANA bootstrap and per-prefix RDAP responses in (optional)",
+	)
+	flags.DurationVar(
+		&conf.rdapTTL,
+		"rdap-ttl",
+		24*time.Hour,
+		"How long a cached RDAP response is trusted before refetching",
+	)
+	flags.IntVar(
+		&conf.workers,
+		"workers",
+		0,
+		"Number of concurrent MMDB lookup workers (default runtime.NumCPU())",
+	)
+	flags.BoolVar(
+		&conf.progress,
+		"progress",
+		false,
+		"Print periodic throughput (rows/sec, ETA) to stderr while processing",
+	)
+	flags.StringVar(
+		&conf.emitPatch,
+		"emit-patch",
+		"",
+		"Write the rows that disagree with the MMDB here as an 'expected corrections' patch "+
+			"(.json for a JSON array, otherwise an RFC 8805 CSV subset); "+
+			"a companion *.agreed* file lists the prefixes that already match",
+	)
 	flags.BoolVar(&conf.version, "V", false, "Display version")
 	flags.BoolVar(
 		&conf.laxMode,
@@ -121,6 +285,18 @@ func parseFlags(program string, args []string) (c *config, output string, err er
 		flags.PrintDefaults()
 		return nil, buf.String(), errors.New("-db is required")
 	}
+	if conf.isp != "" && conf.asn != "" {
+		flags.PrintDefaults()
+		return nil, buf.String(), errors.New("-isp and -asn can not both be set")
+	}
+	if !outputFormats[conf.format] {
+		flags.PrintDefaults()
+		return nil, buf.String(), fmt.Errorf("-format must be one of text, json, csv, got %q", conf.format)
+	}
+	if conf.rdap && !strings.HasPrefix(conf.gf, "http://") && !strings.HasPrefix(conf.gf, "https://") {
+		flags.PrintDefaults()
+		return nil, buf.String(), errors.New("-rdap requires -gf to be an http(s) URL")
+	}
 
 	return &conf, buf.String(), nil
 }
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/maxmind/mm-geofeed-verifier/verify"
+)
+
+// emitPatch writes the "expected corrections" patch for diffs to path, plus
+// a companion file listing the prefixes that already agree with the MMDB,
+// so operators can prune their geofeed down to only meaningful corrections
+// before resubmitting it to MaxMind. allPrefixes is every prefix in the
+// geofeed, in file order, used to compute the agreeing set.
+func emitPatch(path string, diffs []verify.DiffRecord, allPrefixes []string) error {
+	patch := verify.BuildPatch(diffs)
+	agreed := verify.AgreedPrefixes(allPrefixes, diffs)
+
+	if err := writePatchFile(path, patch); err != nil {
+		return fmt.Errorf("writing patch %s: %w", path, err)
+	}
+
+	agreedPath := agreedPatchPath(path)
+	if err := writeAgreedFile(agreedPath, agreed); err != nil {
+		return fmt.Errorf("writing agreed prefixes %s: %w", agreedPath, err)
+	}
+
+	return nil
+}
+
+// agreedPatchPath derives the companion "fully agrees" file path from the
+// -emit-patch path, e.g. "out.csv" -> "out.agreed.csv". Only the final path
+// element is split on its extension, so a dot anywhere in the directory
+// portion (e.g. "/data/2026.07/patch.json") doesn't derail it.
+func agreedPatchPath(path string) string {
+	dir, base := filepath.Split(path)
+	ext := ""
+	if i := strings.LastIndex(base, "."); i >= 0 {
+		ext = base[i:]
+		base = base[:i]
+	}
+	return filepath.Join(dir, base+".agreed"+ext)
+}
+
+// writePatchFile writes patch as a JSON array if path ends in ".json", or
+// an RFC 8805 CSV subset (network,country,region,city,postal) otherwise.
+func writePatchFile(path string, patch []verify.PatchRecord) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if strings.HasSuffix(path, ".json") {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		return enc.Encode(patch)
+	}
+
+	cw := csv.NewWriter(f)
+	for _, p := range patch {
+		if err := cw.Write([]string{p.Network, p.Country, p.Region, p.City, p.Postal}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeAgreedFile writes the agreeing prefixes to path: a JSON array of
+// strings if path ends in ".json", otherwise a bare list, one per line.
+func writeAgreedFile(path string, prefixes []string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if strings.HasSuffix(path, ".json") {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		return enc.Encode(prefixes)
+	}
+
+	for _, prefix := range prefixes {
+		if _, err := fmt.Fprintln(f, prefix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/maxmind/mm-geofeed-verifier/verify"
+)
+
+// TestAgreedPatchPath is a regression test: agreedPatchPath used to split
+// the whole path on its last "." instead of just the final path element,
+// so a dot anywhere in the directory (e.g. "/data/2026.07/patch.json")
+// produced a broken sibling path.
+func TestAgreedPatchPath(t *testing.T) {
+	cases := []struct {
+		path string
+		want string
+	}{
+		{"out.csv", "out.agreed.csv"},
+		{"out.json", "out.agreed.json"},
+		{"out", "out.agreed"},
+		{"/data/2026.07/patch.json", "/data/2026.07/patch.agreed.json"},
+		{"/tmp/my.dir/output", "/tmp/my.dir/output.agreed"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.path, func(t *testing.T) {
+			if got := agreedPatchPath(tc.path); got != tc.want {
+				t.Fatalf("agreedPatchPath(%q) = %q, want %q", tc.path, got, tc.want)
+			}
+		})
+	}
+}
+
+// TestEmitPatchWritesCorrectionsAndAgreedPrefixes checks emitPatch end to
+// end: the patch file holds one entry per disagreeing row using the MMDB's
+// values, and the companion agreed file holds every other prefix.
+func TestEmitPatchWritesCorrectionsAndAgreedPrefixes(t *testing.T) {
+	diffs := []verify.DiffRecord{
+		{Line: 2, Prefix: "203.0.113.0/24", ExpectedCountry: "US", ExpectedRegion: "US-NY", ExpectedCity: "New York", ExpectedPostal: "10001"},
+	}
+	allPrefixes := []string{"198.51.100.0/24", "203.0.113.0/24", "192.0.2.0/24"}
+
+	path := filepath.Join(t.TempDir(), "patch.csv")
+	if err := emitPatch(path, diffs, allPrefixes); err != nil {
+		t.Fatalf("emitPatch: %v", err)
+	}
+
+	patchBody, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading patch file: %v", err)
+	}
+	wantPatch := "203.0.113.0/24,US,US-NY,New York,10001\n"
+	if string(patchBody) != wantPatch {
+		t.Fatalf("patch file = %q, want %q", patchBody, wantPatch)
+	}
+
+	agreedBody, err := os.ReadFile(agreedPatchPath(path))
+	if err != nil {
+		t.Fatalf("reading agreed file: %v", err)
+	}
+	wantAgreed := "198.51.100.0/24\n192.0.2.0/24\n"
+	if string(agreedBody) != wantAgreed {
+		t.Fatalf("agreed file = %q, want %q", agreedBody, wantAgreed)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/maxmind/mm-geofeed-verifier/verify"
+)
+
+// renderer writes a completed verification run to w in a particular format.
+// rdapFindings is nil unless -rdap was passed.
+type renderer func(
+	w io.Writer,
+	c *verify.Counts,
+	diffs []verify.DiffRecord,
+	asnCounts []asnCount,
+	rdapFindings []verify.RDAPFinding,
+) error
+
+// renderers maps a -format value to the renderer that implements it.
+var renderers = map[string]renderer{
+	"text": renderText,
+	"json": renderJSON,
+	"csv":  renderCSV,
+}
+
+// renderText reproduces the original human-readable report.
+func renderText(
+	w io.Writer,
+	c *verify.Counts,
+	diffs []verify.DiffRecord,
+	asnCounts []asnCount,
+	rdapFindings []verify.RDAPFinding,
+) error {
+	for _, d := range diffs {
+		fmt.Fprintf(
+			w,
+			"Line %d, prefix %s (%s):\n"+
+				"  geofeed: country=%s region=%s city=%s postal=%s\n"+
+				"  mmdb:    country=%s region=%s city=%s postal=%s\n\n",
+			d.Line, d.Prefix, d.Reason,
+			d.Country, d.Region, d.City, d.Postal,
+			d.ExpectedCountry, d.ExpectedRegion, d.ExpectedCity, d.ExpectedPostal,
+		)
+	}
+
+	fmt.Fprintf(
+		w,
+		"Out of %d potential corrections, %d may be different than our current mappings\n\n",
+		c.Total,
+		c.Differences,
+	)
+
+	for _, ac := range asnCounts {
+		fmt.Fprintf(w, "ASN: %d, count: %d\n", ac.ASN, ac.Count)
+	}
+
+	unauthorized := 0
+	for _, f := range rdapFindings {
+		if !f.Authorized {
+			unauthorized++
+			fmt.Fprintf(w, "UNAUTHORIZED: %s is not covered by a matching geofeed= remark at RDAP (%s)\n", f.Prefix, f.RDAPBase)
+		}
+	}
+	if len(rdapFindings) > 0 {
+		fmt.Fprintf(w, "\n%d of %d prefixes are not RDAP-authorized for this geofeed\n", unauthorized, len(rdapFindings))
+	}
+
+	return nil
+}
+
+// jsonReport is the top-level shape written by renderJSON.
+type jsonReport struct {
+	Total       int                  `json:"total"`
+	Differences int                  `json:"differences"`
+	Diffs       []verify.DiffRecord  `json:"diffs"`
+	ASNCounts   []asnCount           `json:"asn_counts"`
+	RDAP        []verify.RDAPFinding `json:"rdap,omitempty"`
+}
+
+func renderJSON(
+	w io.Writer,
+	c *verify.Counts,
+	diffs []verify.DiffRecord,
+	asnCounts []asnCount,
+	rdapFindings []verify.RDAPFinding,
+) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(jsonReport{
+		Total:       c.Total,
+		Differences: c.Differences,
+		Diffs:       diffs,
+		ASNCounts:   asnCounts,
+		RDAP:        rdapFindings,
+	})
+}
+
+// renderCSV writes one row per diff record; the ASN counts summary doesn't
+// fit the same table and is omitted, matching how CI/jq consumers only want
+// the diff rows.
+func renderCSV(
+	w io.Writer,
+	_ *verify.Counts,
+	diffs []verify.DiffRecord,
+	_ []asnCount,
+	_ []verify.RDAPFinding,
+) error {
+	cw := csv.NewWriter(w)
+
+	header := []string{
+		"line", "prefix",
+		"country", "region", "city", "postal",
+		"expected_country", "expected_region", "expected_city", "expected_postal",
+		"asn", "asn_org", "reason",
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	for _, d := range diffs {
+		row := []string{
+			strconv.Itoa(d.Line), d.Prefix,
+			d.Country, d.Region, d.City, d.Postal,
+			d.ExpectedCountry, d.ExpectedRegion, d.ExpectedCity, d.ExpectedPostal,
+			strconv.FormatUint(uint64(d.ASN), 10), d.ASNOrg, d.Reason,
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
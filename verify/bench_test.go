@@ -0,0 +1,54 @@
+package verify
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"testing"
+)
+
+// syntheticGeofeed writes n rows of plausible, if not geographically
+// accurate, geofeed data to a temp file and returns its path.
+func syntheticGeofeed(tb testing.TB, n int) string {
+	tb.Helper()
+
+	f, err := os.CreateTemp(tb.TempDir(), "bench-*.csv")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	for i := 0; i < n; i++ {
+		a := (i >> 8) & 0xff
+		b := i & 0xff
+		fmt.Fprintf(w, "203.0.%d.%d/32,US,US-CA,San Francisco,94105\n", a, b)
+	}
+	if err := w.Flush(); err != nil {
+		tb.Fatal(err)
+	}
+
+	return f.Name()
+}
+
+// BenchmarkProcessGeofeed measures ProcessGeofeed's throughput on a
+// synthetic 1M-row feed across a range of worker counts, demonstrating the
+// speedup from the concurrent worker pool.
+func BenchmarkProcessGeofeed(b *testing.B) {
+	db := os.Getenv("GEOFEED_BENCH_DB")
+	if db == "" {
+		b.Skip("set GEOFEED_BENCH_DB to a city MMDB to run this benchmark")
+	}
+
+	gf := syntheticGeofeed(b, 1_000_000)
+
+	for _, workers := range []int{1, 2, 4, 8, 16} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, _, _, err := ProcessGeofeed(gf, db, "", "", Options{Workers: workers}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+package verify
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+)
+
+// cacheFilename derives a stable, collision-resistant on-disk filename for
+// rawURL under dir, used to cache downloads keyed by the URL they came
+// from (geofeed downloads, RDAP bootstrap files, per-prefix RDAP lookups).
+func cacheFilename(dir, rawURL, ext string) string {
+	sum := sha256.Sum256([]byte(rawURL))
+	return filepath.Join(dir, hex.EncodeToString(sum[:])+"."+ext)
+}
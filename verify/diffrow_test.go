@@ -0,0 +1,39 @@
+package verify
+
+import "testing"
+
+// TestDiffRowRegionMatching is a regression test for a bug in diffRow's
+// first version: strict (non-lax) mode compared the geofeed's region code
+// against the bare subdivision code instead of the full "US-NY" form,
+// making it behave identically to -lax.
+func TestDiffRowRegionMatching(t *testing.T) {
+	record := &cityRecord{}
+	record.Country.IsoCode = "US"
+	record.Subdivisions = []struct {
+		IsoCode string `maxminddb:"iso_code"`
+	}{{IsoCode: "NY"}}
+
+	cases := []struct {
+		name     string
+		laxMode  bool
+		region   string
+		wantDiff bool
+	}{
+		{name: "strict mode rejects bare region code", laxMode: false, region: "NY", wantDiff: true},
+		{name: "strict mode accepts full country-region code", laxMode: false, region: "US-NY", wantDiff: false},
+		{name: "lax mode accepts bare region code", laxMode: true, region: "NY", wantDiff: false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			row := []string{"203.0.113.0/24", "US", tc.region}
+			diff := diffRow(1, row, tc.laxMode, record)
+			if tc.wantDiff && diff == nil {
+				t.Fatalf("expected a region mismatch, got none")
+			}
+			if !tc.wantDiff && diff != nil {
+				t.Fatalf("expected no diff, got %+v", diff)
+			}
+		})
+	}
+}
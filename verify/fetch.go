@@ -0,0 +1,298 @@
+package verify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+// defaultMaxBytes bounds how much of a remote geofeed we'll read when the
+// caller doesn't set FetchOptions.MaxBytes, to avoid an unbounded download
+// from a misbehaving or malicious server.
+const defaultMaxBytes = 100 << 20 // 100MiB
+
+// maxRedirects caps how many same-scheme redirects we'll follow when
+// fetching a geofeed.
+const maxRedirects = 10
+
+// FetchOptions configures how ProcessGeofeedURL retrieves a remote geofeed
+// published per RFC 8805 section 3.3.
+type FetchOptions struct {
+	// CacheDir, if set, stores the downloaded geofeed plus its ETag and
+	// Last-Modified response headers, so later runs can send a conditional
+	// request and skip the download entirely when the feed hasn't changed.
+	CacheDir string
+
+	// MaxBytes caps the size of the downloaded geofeed. Zero means
+	// defaultMaxBytes.
+	MaxBytes int64
+
+	// Keyring, if set, is a path to an armored OpenPGP keyring. The geofeed
+	// must then have a valid detached signature at rawURL+".asc" signed by
+	// a key in the keyring, or ProcessGeofeedURL returns an error.
+	Keyring string
+}
+
+// cacheMeta is the conditional-request state we persist alongside a cached
+// geofeed download.
+type cacheMeta struct {
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	FetchedAt    time.Time `json:"fetched_at"`
+
+	// SignatureVerified records whether the cached body already passed a
+	// -verify-sig check. A conditional request is only sent when this is
+	// true (or no keyring is configured), so turning -verify-sig on
+	// doesn't silently trust a cached copy that was never checked.
+	SignatureVerified bool `json:"signature_verified,omitempty"`
+}
+
+// ProcessGeofeedURL downloads the geofeed published at rawURL and otherwise
+// behaves like ProcessGeofeed. It returns the effective Last-Modified time
+// reported by the server (the zero Time if the server didn't send one) in
+// addition to ProcessGeofeed's usual results.
+func ProcessGeofeedURL(
+	rawURL, db, isp, asn string,
+	processOpts Options,
+	fetchOpts FetchOptions,
+) (*Counts, []DiffRecord, map[uint]int, time.Time, error) {
+	path, lastModified, err := fetchGeofeed(rawURL, fetchOpts)
+	if err != nil {
+		return nil, nil, nil, time.Time{}, err
+	}
+	// Without -cache, fetchGeofeed wrote the download to a one-off temp
+	// file nothing else will ever read again; a cached path, by contrast,
+	// is meant to persist across runs.
+	if fetchOpts.CacheDir == "" {
+		defer os.Remove(path)
+	}
+
+	c, diffs, asnCounts, err := ProcessGeofeed(path, db, isp, asn, processOpts)
+	return c, diffs, asnCounts, lastModified, err
+}
+
+// FetchPrefixes downloads the geofeed at rawURL, like ProcessGeofeedURL,
+// and returns just its prefix column, for callers that don't need an MMDB
+// comparison.
+func FetchPrefixes(rawURL string, opts FetchOptions) ([]string, error) {
+	path, _, err := fetchGeofeed(rawURL, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.CacheDir == "" {
+		defer os.Remove(path)
+	}
+	return ReadPrefixes(path)
+}
+
+// FetchToFile downloads the geofeed at rawURL, honoring opts exactly like
+// ProcessGeofeedURL, and returns the local path it was saved to (or read
+// from, if the cache was fresh). Callers that need more than one view of a
+// URL -gf (for example a diff plus an -rdap cross-check) should fetch it
+// once with FetchToFile and reuse the resulting path, rather than calling
+// ProcessGeofeedURL/FetchPrefixes separately and risking each fetch seeing
+// different content.
+//
+// The returned cleanup func must be called once the caller is done with
+// path: without -cache, fetchGeofeed wrote path to a one-off temp file that
+// nothing else will ever read again, and cleanup removes it. With -cache,
+// path is the persistent cache file and cleanup is a no-op.
+func FetchToFile(rawURL string, opts FetchOptions) (path string, lastModified time.Time, cleanup func(), err error) {
+	path, lastModified, err = fetchGeofeed(rawURL, opts)
+	if err != nil {
+		return "", time.Time{}, func() {}, err
+	}
+	cleanup = func() {}
+	if opts.CacheDir == "" {
+		cleanup = func() { os.Remove(path) }
+	}
+	return path, lastModified, cleanup, nil
+}
+
+// fetchGeofeed downloads rawURL, honoring the local cache and, if
+// opts.Keyring is set, verifying a detached RFC 8805 section 3.3 signature.
+// It returns the path to a local file holding the geofeed contents.
+func fetchGeofeed(rawURL string, opts FetchOptions) (string, time.Time, error) {
+	maxBytes := opts.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxBytes
+	}
+
+	cachePath, metaPath := cachePaths(opts.CacheDir, rawURL)
+	var meta cacheMeta
+	if cachePath != "" {
+		meta = readCacheMeta(metaPath)
+	}
+
+	client := &http.Client{
+		CheckRedirect: sameSchemeRedirectPolicy,
+	}
+
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("building request for %s: %w", rawURL, err)
+	}
+	// A conditional request only reuses the cached body, so it's only safe
+	// once that body has already passed -verify-sig (or -verify-sig isn't
+	// in use). Otherwise we force a full re-fetch so it can be verified.
+	if opts.Keyring == "" || meta.SignatureVerified {
+		if meta.ETag != "" {
+			req.Header.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", meta.LastModified)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("fetching %s: %w", rawURL, err)
+	}
+	defer resp.Body.Close()
+
+	lastModified, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+
+	if resp.StatusCode == http.StatusNotModified {
+		if cachePath == "" {
+			return "", time.Time{}, fmt.Errorf("%s: server returned 304 but no -cache directory was given", rawURL)
+		}
+		return cachePath, lastModified, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", time.Time{}, fmt.Errorf("fetching %s: unexpected status %s", rawURL, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("reading %s: %w", rawURL, err)
+	}
+	if int64(len(body)) > maxBytes {
+		return "", time.Time{}, fmt.Errorf("%s exceeds the %d byte limit", rawURL, maxBytes)
+	}
+
+	if opts.Keyring != "" {
+		if err := verifySignature(rawURL, body, opts.Keyring, client); err != nil {
+			return "", time.Time{}, err
+		}
+	}
+
+	path := cachePath
+	if path == "" {
+		f, err := os.CreateTemp("", "geofeed-*.csv")
+		if err != nil {
+			return "", time.Time{}, fmt.Errorf("creating temp file for %s: %w", rawURL, err)
+		}
+		path = f.Name()
+		defer f.Close()
+		if _, err := f.Write(body); err != nil {
+			return "", time.Time{}, fmt.Errorf("writing %s: %w", path, err)
+		}
+	} else {
+		if err := os.MkdirAll(opts.CacheDir, 0o755); err != nil {
+			return "", time.Time{}, fmt.Errorf("creating cache dir %s: %w", opts.CacheDir, err)
+		}
+		if err := os.WriteFile(cachePath, body, 0o644); err != nil {
+			return "", time.Time{}, fmt.Errorf("writing %s: %w", cachePath, err)
+		}
+		meta = cacheMeta{
+			ETag:              resp.Header.Get("ETag"),
+			LastModified:      resp.Header.Get("Last-Modified"),
+			FetchedAt:         time.Now(),
+			SignatureVerified: opts.Keyring != "",
+		}
+		if err := writeCacheMeta(metaPath, meta); err != nil {
+			return "", time.Time{}, err
+		}
+	}
+
+	return path, lastModified, nil
+}
+
+// sameSchemeRedirectPolicy follows redirects only when the scheme doesn't
+// change, so an https:// geofeed URL can't be silently downgraded to
+// http://, and bounds the redirect chain length.
+func sameSchemeRedirectPolicy(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	if req.URL.Scheme != via[0].URL.Scheme {
+		return fmt.Errorf("refusing to redirect from %s to %s", via[0].URL.Scheme, req.URL.Scheme)
+	}
+	return nil
+}
+
+// cachePaths derives the on-disk cache file and metadata file for rawURL
+// under dir. It returns ("", "") when dir is empty, meaning caching is
+// disabled.
+func cachePaths(dir, rawURL string) (string, string) {
+	if dir == "" {
+		return "", ""
+	}
+	return cacheFilename(dir, rawURL, "csv"), cacheFilename(dir, rawURL, "json")
+}
+
+func readCacheMeta(path string) cacheMeta {
+	var meta cacheMeta
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return meta
+	}
+	_ = json.Unmarshal(b, &meta)
+	return meta
+}
+
+func writeCacheMeta(path string, meta cacheMeta) error {
+	b, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("encoding cache metadata: %w", err)
+	}
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return nil
+}
+
+// verifySignature fetches the detached signature published alongside a
+// geofeed at rawURL+".asc", as described in RFC 8805 section 3.3, and
+// checks it against body using the armored keyring at keyringPath.
+func verifySignature(rawURL string, body []byte, keyringPath string, client *http.Client) error {
+	sigURL, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("parsing %s: %w", rawURL, err)
+	}
+	sigURL.Path += ".asc"
+
+	resp, err := client.Get(sigURL.String())
+	if err != nil {
+		return fmt.Errorf("fetching signature %s: %w", sigURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching signature %s: unexpected status %s", sigURL, resp.Status)
+	}
+
+	keyringFile, err := os.Open(keyringPath)
+	if err != nil {
+		return fmt.Errorf("opening keyring %s: %w", keyringPath, err)
+	}
+	defer keyringFile.Close()
+
+	keyring, err := openpgp.ReadArmoredKeyRing(keyringFile)
+	if err != nil {
+		return fmt.Errorf("reading keyring %s: %w", keyringPath, err)
+	}
+
+	if _, err := openpgp.CheckArmoredDetachedSignature(keyring, bytes.NewReader(body), resp.Body); err != nil {
+		return fmt.Errorf("%s: signature verification failed: %w", rawURL, err)
+	}
+
+	return nil
+}
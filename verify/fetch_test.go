@@ -0,0 +1,162 @@
+package verify
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestFetchGeofeedCreatesCacheDir is a regression test: fetchGeofeed used to
+// write straight to -cache without creating it first, so a fresh -cache
+// path failed every time with "no such file or directory".
+func TestFetchGeofeedCreatesCacheDir(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("203.0.113.0/24,US\n"))
+	}))
+	defer srv.Close()
+
+	dir := filepath.Join(t.TempDir(), "newdir")
+	path, _, cleanup, err := FetchToFile(srv.URL, FetchOptions{CacheDir: dir})
+	if err != nil {
+		t.Fatalf("FetchToFile: %v", err)
+	}
+	defer cleanup()
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("expected cached file to exist: %v", err)
+	}
+}
+
+// TestFetchGeofeedCleansUpTempFile is a regression test: without -cache,
+// fetchGeofeed wrote every download to a fresh os.CreateTemp file that
+// nothing ever removed, leaking one per call.
+func TestFetchGeofeedCleansUpTempFile(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("203.0.113.0/24,US\n"))
+	}))
+	defer srv.Close()
+
+	path, _, cleanup, err := FetchToFile(srv.URL, FetchOptions{})
+	if err != nil {
+		t.Fatalf("FetchToFile: %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("expected temp file to exist before cleanup: %v", err)
+	}
+
+	cleanup()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected temp file to be removed after cleanup, stat err = %v", err)
+	}
+}
+
+// TestFetchGeofeedForcesRefetchUntilSignatureVerified is a regression test:
+// once -verify-sig is turned on, fetchGeofeed used to send a conditional
+// request against a cache entry from before -verify-sig was ever used, so a
+// 304 response handed back unverified content without running
+// verifySignature.
+func TestFetchGeofeedForcesRefetchUntilSignatureVerified(t *testing.T) {
+	var sawConditionalHeaders bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/geofeed.csv.asc" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Modified-Since") != "" {
+			sawConditionalHeaders = true
+		}
+		w.Header().Set("ETag", `"abc"`)
+		w.Write([]byte("203.0.113.0/24,US\n"))
+	}))
+	defer srv.Close()
+
+	geofeedURL := srv.URL + "/geofeed.csv"
+	dir := t.TempDir()
+
+	// First fetch: no keyring, so the cached copy is written with
+	// SignatureVerified=false.
+	path, _, cleanup, err := FetchToFile(geofeedURL, FetchOptions{CacheDir: dir})
+	if err != nil {
+		t.Fatalf("first FetchToFile: %v", err)
+	}
+	cleanup()
+	_, metaPath := cachePaths(dir, geofeedURL)
+	meta := readCacheMeta(metaPath)
+	if meta.SignatureVerified {
+		t.Fatalf("expected SignatureVerified=false after an unsigned fetch")
+	}
+
+	// Second fetch: -verify-sig is now on. The unverified cache entry must
+	// not be trusted via a conditional request, even though it has an
+	// ETag from the first fetch.
+	_, _, cleanup, err = FetchToFile(geofeedURL, FetchOptions{CacheDir: dir, Keyring: filepath.Join(dir, "missing-keyring.asc")})
+	cleanup()
+	if sawConditionalHeaders {
+		t.Fatalf("expected a full re-fetch, but the server saw a conditional request")
+	}
+	// The fetch is expected to fail here since the server publishes no .asc
+	// signature (it answers 404); what matters is that it got far enough to
+	// attempt signature verification instead of short-circuiting on a
+	// cached 304.
+	if err == nil {
+		t.Fatalf("expected signature verification to fail")
+	}
+	_ = path
+}
+
+// TestFetchGeofeedReusesCacheOnceSignatureVerified checks the converse: a
+// cache entry already marked SignatureVerified is safe to reuse via a
+// conditional request.
+func TestFetchGeofeedReusesCacheOnceSignatureVerified(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"abc"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"abc"`)
+		w.Write([]byte("203.0.113.0/24,US\n"))
+	}))
+	defer srv.Close()
+
+	geofeedURL := srv.URL + "/geofeed.csv"
+	dir := t.TempDir()
+	cachePath, metaPath := cachePaths(dir, geofeedURL)
+	if err := os.WriteFile(cachePath, []byte("203.0.113.0/24,US\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeCacheMeta(metaPath, cacheMeta{ETag: `"abc"`, SignatureVerified: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	path, _, cleanup, err := FetchToFile(geofeedURL, FetchOptions{CacheDir: dir, Keyring: "/irrelevant/keyring.asc"})
+	if err != nil {
+		t.Fatalf("FetchToFile: %v", err)
+	}
+	defer cleanup()
+	if path != cachePath {
+		t.Fatalf("path = %q, want cached path %q", path, cachePath)
+	}
+	if requests != 1 {
+		t.Fatalf("expected exactly one request to the server, got %d", requests)
+	}
+}
+
+// TestSameSchemeRedirectPolicyRejectsSchemeDowngrade checks that an
+// https:// geofeed URL can't be silently redirected to http://.
+func TestSameSchemeRedirectPolicyRejectsSchemeDowngrade(t *testing.T) {
+	via := &http.Request{URL: &url.URL{Scheme: "https"}}
+	downgraded := &http.Request{URL: &url.URL{Scheme: "http"}}
+
+	if err := sameSchemeRedirectPolicy(downgraded, []*http.Request{via}); err == nil {
+		t.Fatalf("expected an error redirecting from https to http")
+	}
+
+	sameScheme := &http.Request{URL: &url.URL{Scheme: "https"}}
+	if err := sameSchemeRedirectPolicy(sameScheme, []*http.Request{via}); err != nil {
+		t.Fatalf("unexpected error for a same-scheme redirect: %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package verify
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeCityReader is a deterministic, in-memory stand-in for a
+// *maxminddb.Reader used to test processRows' reorder-buffer logic without
+// a real MMDB file. It reports disagreement for every other IP (by the low
+// octet's parity) so roughly half the rows produce a diff.
+type fakeCityReader struct{}
+
+func (fakeCityReader) Lookup(ip net.IP, result interface{}) error {
+	record, ok := result.(*cityRecord)
+	if !ok {
+		return fmt.Errorf("unexpected lookup result type %T", result)
+	}
+	record.Country.IsoCode = "US"
+	if ip.To4()[3]%2 == 0 {
+		record.Country.IsoCode = "CA"
+	}
+	return nil
+}
+
+// TestProcessRowsPreservesFileOrder checks that diffs come back ordered
+// by line number even though rows are looked up concurrently
+// across multiple workers and reassembled from a pending-results buffer.
+func TestProcessRowsPreservesFileOrder(t *testing.T) {
+	const rows = 200
+	var sb strings.Builder
+	for i := 0; i < rows; i++ {
+		fmt.Fprintf(&sb, "203.0.113.%d/32,US\n", i)
+	}
+
+	c, diffs, _, err := processRows(strings.NewReader(sb.String()), fakeCityReader{}, nil, false, 4, 0, nil)
+	if err != nil {
+		t.Fatalf("processRows: %v", err)
+	}
+	if c.Total != rows {
+		t.Fatalf("Total = %d, want %d", c.Total, rows)
+	}
+
+	lastLine := 0
+	for _, d := range diffs {
+		if d.Line <= lastLine {
+			t.Fatalf("diffs out of order: line %d came after line %d", d.Line, lastLine)
+		}
+		lastLine = d.Line
+
+		gotOctet, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(d.Prefix, "203.0.113."), "/32"))
+		if err != nil {
+			t.Fatalf("parsing prefix %q: %v", d.Prefix, err)
+		}
+		if gotOctet != d.Line-1 {
+			t.Fatalf("diff for line %d has prefix %q, want octet %d", d.Line, d.Prefix, d.Line-1)
+		}
+	}
+}
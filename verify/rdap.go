@@ -0,0 +1,206 @@
+package verify
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// IANA publishes one bootstrap registry per address family, mapping CIDR
+// ranges to the RIR RDAP service that's authoritative for them.
+const (
+	ianaIPv4Bootstrap = "https://data.iana.org/rdap/ipv4.rdap.bootstrap.json"
+	ianaIPv6Bootstrap = "https://data.iana.org/rdap/ipv6.rdap.bootstrap.json"
+)
+
+// RDAPOptions configures CheckGeofeedAuthorization's disk caching.
+type RDAPOptions struct {
+	// CacheDir, if set, caches the IANA bootstrap files and per-prefix RDAP
+	// responses on disk for TTL before refetching them.
+	CacheDir string
+	// TTL is how long a cached response is trusted. Zero means always
+	// refetch.
+	TTL time.Duration
+}
+
+// RDAPFinding reports whether a prefix's RDAP registration authorizes the
+// geofeed URL that claims to cover it.
+type RDAPFinding struct {
+	Prefix     string   `json:"prefix"`
+	Authorized bool     `json:"authorized"`
+	RDAPBase   string   `json:"rdap_base,omitempty"`
+	Remarks    []string `json:"remarks,omitempty"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// bootstrapFile is the shape of an IANA RDAP bootstrap registry file: a
+// list of [cidrs, rdapBaseURLs] service entries.
+type bootstrapFile struct {
+	Services [][][]string `json:"services"`
+}
+
+// rdapResponse is the subset of an RDAP ip network response we care about.
+type rdapResponse struct {
+	Remarks []struct {
+		Description []string `json:"description"`
+	} `json:"remarks"`
+}
+
+// CheckGeofeedAuthorization looks up each prefix's RDAP registration via
+// the IANA bootstrap and reports whether its network object carries a
+// "geofeed=<geofeedURL>" remark, per RFC 8805 section 3.3. A prefix that
+// the geofeed itself claims but whose RDAP object doesn't authorize is
+// reported with Authorized=false: MaxMind won't honor a correction RDAP
+// doesn't back. Findings are returned in the same order as prefixes.
+func CheckGeofeedAuthorization(prefixes []string, geofeedURL string, opts RDAPOptions) ([]RDAPFinding, error) {
+	if geofeedURL == "" {
+		return nil, fmt.Errorf("-rdap requires -gf to be an http(s) URL to cross-check against")
+	}
+
+	v4, err := loadBootstrap(ianaIPv4Bootstrap, opts)
+	if err != nil {
+		return nil, err
+	}
+	v6, err := loadBootstrap(ianaIPv6Bootstrap, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	findings := make([]RDAPFinding, len(prefixes))
+	for i, prefix := range prefixes {
+		findings[i] = checkPrefix(prefix, geofeedURL, v4, v6, opts)
+	}
+	return findings, nil
+}
+
+func checkPrefix(prefix, geofeedURL string, v4, v6 *bootstrapFile, opts RDAPOptions) RDAPFinding {
+	ip, _, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return RDAPFinding{Prefix: prefix, Error: err.Error()}
+	}
+
+	bootstrap := v4
+	if ip.To4() == nil {
+		bootstrap = v6
+	}
+
+	base := bootstrap.lookup(ip)
+	if base == "" {
+		return RDAPFinding{Prefix: prefix, Error: "no RIR found in IANA bootstrap for this prefix"}
+	}
+
+	body, err := cachedGET(strings.TrimRight(base, "/")+"/ip/"+prefix, opts)
+	if err != nil {
+		return RDAPFinding{Prefix: prefix, RDAPBase: base, Error: err.Error()}
+	}
+
+	var resp rdapResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return RDAPFinding{Prefix: prefix, RDAPBase: base, Error: fmt.Errorf("parsing RDAP response: %w", err).Error()}
+	}
+
+	var remarks []string
+	authorized := false
+	for _, r := range resp.Remarks {
+		for _, line := range r.Description {
+			if !strings.HasPrefix(strings.TrimSpace(line), "geofeed=") {
+				continue
+			}
+			remarks = append(remarks, line)
+			if strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "geofeed=")) == geofeedURL {
+				authorized = true
+			}
+		}
+	}
+
+	return RDAPFinding{
+		Prefix:     prefix,
+		Authorized: authorized,
+		RDAPBase:   base,
+		Remarks:    remarks,
+	}
+}
+
+// lookup returns the RDAP base URL whose CIDR entry most specifically
+// contains ip, or "" if none do.
+func (b *bootstrapFile) lookup(ip net.IP) string {
+	best := -1
+	bestBase := ""
+	for _, service := range b.Services {
+		if len(service) != 2 {
+			continue
+		}
+		cidrs, bases := service[0], service[1]
+		if len(bases) == 0 {
+			continue
+		}
+		for _, cidr := range cidrs {
+			_, network, err := net.ParseCIDR(cidr)
+			if err != nil || !network.Contains(ip) {
+				continue
+			}
+			ones, _ := network.Mask.Size()
+			if ones > best {
+				best = ones
+				bestBase = bases[0]
+			}
+		}
+	}
+	return bestBase
+}
+
+// loadBootstrap fetches (or reads from cache) an IANA RDAP bootstrap file.
+func loadBootstrap(url string, opts RDAPOptions) (*bootstrapFile, error) {
+	body, err := cachedGET(url, opts)
+	if err != nil {
+		return nil, fmt.Errorf("fetching RDAP bootstrap %s: %w", url, err)
+	}
+
+	var bf bootstrapFile
+	if err := json.Unmarshal(body, &bf); err != nil {
+		return nil, fmt.Errorf("parsing RDAP bootstrap %s: %w", url, err)
+	}
+	return &bf, nil
+}
+
+// cachedGET returns the body of a GET to url, preferring a cached copy
+// younger than opts.TTL when opts.CacheDir is set.
+func cachedGET(url string, opts RDAPOptions) ([]byte, error) {
+	var path string
+	if opts.CacheDir != "" {
+		path = cacheFilename(opts.CacheDir, url, "json")
+		if info, err := os.Stat(path); err == nil && opts.TTL > 0 && time.Since(info.ModTime()) < opts.TTL {
+			return os.ReadFile(path)
+		}
+	}
+
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if path != "" {
+		if err := os.MkdirAll(opts.CacheDir, 0o755); err != nil {
+			return nil, fmt.Errorf("creating cache dir %s: %w", opts.CacheDir, err)
+		}
+		if err := os.WriteFile(path, body, 0o644); err != nil {
+			return nil, fmt.Errorf("writing %s: %w", path, err)
+		}
+	}
+
+	return body, nil
+}
@@ -0,0 +1,101 @@
+package verify
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestBootstrapFileLookupLongestPrefixMatch checks that lookup picks the
+// most specific (longest-prefix) CIDR entry covering ip, not just the first
+// matching one, as IANA bootstrap files can list overlapping ranges.
+func TestBootstrapFileLookupLongestPrefixMatch(t *testing.T) {
+	bf := &bootstrapFile{
+		Services: [][][]string{
+			{{"203.0.0.0/8"}, {"https://rdap.example/broad"}},
+			{{"203.0.113.0/24"}, {"https://rdap.example/specific"}},
+		},
+	}
+
+	got := bf.lookup(net.ParseIP("203.0.113.5"))
+	if got != "https://rdap.example/specific" {
+		t.Fatalf("lookup = %q, want the longest-prefix match", got)
+	}
+}
+
+// TestBootstrapFileLookupNoMatch checks that lookup returns "" when no
+// service entry's CIDR contains ip.
+func TestBootstrapFileLookupNoMatch(t *testing.T) {
+	bf := &bootstrapFile{
+		Services: [][][]string{
+			{{"198.51.100.0/24"}, {"https://rdap.example/other"}},
+		},
+	}
+
+	if got := bf.lookup(net.ParseIP("203.0.113.5")); got != "" {
+		t.Fatalf("lookup = %q, want \"\"", got)
+	}
+}
+
+// TestCheckPrefixAuthorization checks that checkPrefix reports Authorized
+// only when the RDAP object's remarks carry a "geofeed=" line matching
+// geofeedURL exactly, not merely a geofeed remark pointing elsewhere.
+func TestCheckPrefixAuthorization(t *testing.T) {
+	const geofeedURL = "https://example.com/geofeed.csv"
+
+	cases := []struct {
+		name     string
+		remarks  []string
+		wantAuth bool
+	}{
+		{
+			name:     "matching geofeed remark",
+			remarks:  []string{"geofeed=" + geofeedURL},
+			wantAuth: true,
+		},
+		{
+			name:     "geofeed remark for a different URL",
+			remarks:  []string{"geofeed=https://other.example/geofeed.csv"},
+			wantAuth: false,
+		},
+		{
+			name:     "no geofeed remark",
+			remarks:  []string{"some other remark"},
+			wantAuth: false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintf(w, `{"remarks":[{"description":%s}]}`, mustMarshalStrings(tc.remarks))
+			}))
+			defer srv.Close()
+
+			bootstrap := &bootstrapFile{
+				Services: [][][]string{{{"203.0.113.0/24"}, {srv.URL}}},
+			}
+
+			finding := checkPrefix("203.0.113.0/24", geofeedURL, bootstrap, bootstrap, RDAPOptions{})
+			if finding.Error != "" {
+				t.Fatalf("unexpected error: %s", finding.Error)
+			}
+			if finding.Authorized != tc.wantAuth {
+				t.Fatalf("Authorized = %v, want %v", finding.Authorized, tc.wantAuth)
+			}
+		})
+	}
+}
+
+func mustMarshalStrings(ss []string) string {
+	out := "["
+	for i, s := range ss {
+		if i > 0 {
+			out += ","
+		}
+		out += fmt.Sprintf("%q", s)
+	}
+	return out + "]"
+}
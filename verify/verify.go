@@ -0,0 +1,530 @@
+// Package verify implements the comparison of an RFC 8805 geofeed file
+// against MaxMind MMDB databases.
+package verify
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// Counts summarizes how many geofeed rows were processed and how many of
+// those disagreed with the MMDB.
+type Counts struct {
+	Total       int
+	Differences int
+}
+
+// DiffRecord is a single geofeed row whose location data disagreed with the
+// MMDB. Field names are exported so renderers (text, JSON, CSV, ...) can all
+// work from the same structured data instead of a pre-formatted string.
+type DiffRecord struct {
+	Line   int    `json:"line" csv:"line"`
+	Prefix string `json:"prefix" csv:"prefix"`
+
+	Country string `json:"country" csv:"country"`
+	Region  string `json:"region" csv:"region"`
+	City    string `json:"city" csv:"city"`
+	Postal  string `json:"postal" csv:"postal"`
+
+	ExpectedCountry string `json:"expected_country" csv:"expected_country"`
+	ExpectedRegion  string `json:"expected_region" csv:"expected_region"`
+	ExpectedCity    string `json:"expected_city" csv:"expected_city"`
+	ExpectedPostal  string `json:"expected_postal" csv:"expected_postal"`
+
+	ASN    uint   `json:"asn,omitempty" csv:"asn"`
+	ASNOrg string `json:"asn_org,omitempty" csv:"asn_org"`
+
+	Reason string `json:"reason" csv:"reason"`
+}
+
+// cityRecord is the subset of a GeoIP2-City/GeoLite2-City record we compare
+// geofeed rows against.
+type cityRecord struct {
+	Country struct {
+		IsoCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		IsoCode string `maxminddb:"iso_code"`
+	} `maxminddb:"subdivisions"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Postal struct {
+		Code string `maxminddb:"code"`
+	} `maxminddb:"postal"`
+}
+
+// asnRecord is the subset of a GeoLite2-ASN or GeoIP2-ISP record we need.
+// Both database types carry these two fields under the same names.
+type asnRecord struct {
+	AutonomousSystemNumber       uint   `maxminddb:"autonomous_system_number"`
+	AutonomousSystemOrganization string `maxminddb:"autonomous_system_organization"`
+}
+
+// asnDatabaseTypes lists the MMDB "database_type" metadata values we know
+// how to read an ASN out of.
+var asnDatabaseTypes = map[string]bool{
+	"GeoLite2-ASN": true,
+	"GeoIP2-ISP":   true,
+}
+
+// mmdbReader is the subset of *maxminddb.Reader that processRows/lookupRow
+// need, so tests can substitute a fake in place of a real MMDB file.
+type mmdbReader interface {
+	Lookup(ip net.IP, result interface{}) error
+}
+
+// Options controls how ProcessGeofeed processes a geofeed, beyond which
+// files it reads.
+type Options struct {
+	// LaxMode allows a geofeed region code to be given without its country
+	// prefix (e.g. "NY" instead of "US-NY").
+	LaxMode bool
+
+	// Workers is how many goroutines perform concurrent MMDB lookups.
+	// <= 0 means runtime.NumCPU().
+	Workers int
+
+	// Progress, if set, receives a "rows/sec, ETA" line roughly once a
+	// second while the geofeed is processed.
+	Progress io.Writer
+}
+
+// ProcessGeofeed reads the geofeed file at gf, comparing each row against
+// the city database at db. isp and asn are alternative, mutually exclusive
+// sources of per-prefix ASN data: isp points at a paid GeoIP2-ISP database,
+// asn at a free GeoLite2-ASN database. At most one of them may be set.
+//
+// It returns summary counts, one DiffRecord per row that disagreed with the
+// MMDB, and a count of rows seen per ASN.
+func ProcessGeofeed(gf, db, isp, asn string, opts Options) (*Counts, []DiffRecord, map[uint]int, error) {
+	if isp != "" && asn != "" {
+		return nil, nil, nil, fmt.Errorf("only one of -isp or -asn may be set, not both")
+	}
+
+	cityReader, err := maxminddb.Open(db)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("opening city database %s: %w", db, err)
+	}
+	defer cityReader.Close()
+
+	asnPath := isp
+	if asn != "" {
+		asnPath = asn
+	}
+
+	var asnReader *maxminddb.Reader
+	if asnPath != "" {
+		asnReader, err = openASNReader(asnPath)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		defer asnReader.Close()
+	}
+
+	f, err := os.Open(gf)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("opening geofeed %s: %w", gf, err)
+	}
+	defer f.Close()
+
+	var totalRows int
+	if opts.Progress != nil {
+		totalRows, err = countRows(f)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("counting rows in %s: %w", gf, err)
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, nil, nil, fmt.Errorf("rewinding %s: %w", gf, err)
+		}
+	}
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	// asnReader is passed through an mmdbReader interface below; wrapping a
+	// nil *maxminddb.Reader directly in that interface would produce a
+	// non-nil interface value (the classic typed-nil gotcha), breaking the
+	// "no ASN database" check in lookupRow. Only assign it when non-nil.
+	var asnIface mmdbReader
+	if asnReader != nil {
+		asnIface = asnReader
+	}
+
+	return processRows(f, cityReader, asnIface, opts.LaxMode, workers, totalRows, opts.Progress)
+}
+
+// rowJob is one geofeed row queued for an MMDB lookup, tagged with its
+// 1-based line number so results can be reassembled in file order.
+type rowJob struct {
+	lineNumber int
+	row        []string
+}
+
+// rowResult is a completed lookup for one rowJob.
+type rowResult struct {
+	lineNumber int
+	diff       *DiffRecord
+	asn        uint
+	hasASN     bool
+	err        error
+}
+
+// processRows parses r's CSV in one goroutine, feeding a bounded channel of
+// rows to a pool of workers goroutines that each perform MMDB lookups; a
+// maxminddb.Reader is safe for concurrent use, so this gives near-linear
+// speedup on multi-million-line feeds. Results are reassembled into file
+// order before being returned.
+func processRows(
+	r io.Reader,
+	cityReader, asnReader mmdbReader,
+	laxMode bool,
+	workers, totalRows int,
+	progress io.Writer,
+) (*Counts, []DiffRecord, map[uint]int, error) {
+	jobs := make(chan rowJob, workers*4)
+	results := make(chan rowResult, workers*4)
+
+	// done is closed once this function returns, by whichever path. The
+	// parser and worker goroutines select on it around their channel sends
+	// so that an early return (on the first row error) doesn't leave them
+	// blocked forever trying to send to a jobs/results channel nobody is
+	// reading from anymore.
+	done := make(chan struct{})
+	defer close(done)
+
+	var parseErr error
+	go func() {
+		defer close(jobs)
+		csvReader := csv.NewReader(r)
+		csvReader.FieldsPerRecord = -1
+		lineNumber := 0
+		for {
+			row, err := csvReader.Read()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				parseErr = fmt.Errorf("reading geofeed: %w", err)
+				return
+			}
+			lineNumber++
+			if len(row) < 2 {
+				parseErr = fmt.Errorf("line %d: expected at least prefix and country, got %q", lineNumber, row)
+				return
+			}
+			select {
+			case jobs <- rowJob{lineNumber: lineNumber, row: row}:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				select {
+				case results <- lookupRow(job, cityReader, asnReader, laxMode):
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	c := &Counts{}
+	asnCounts := make(map[uint]int)
+	var diffs []DiffRecord
+	pending := make(map[int]rowResult)
+	next := 1
+
+	start := time.Now()
+	lastReport := start
+	processed := 0
+
+	for res := range results {
+		if res.err != nil {
+			return nil, nil, nil, res.err
+		}
+		pending[res.lineNumber] = res
+
+		for r, ok := pending[next]; ok; r, ok = pending[next] {
+			delete(pending, next)
+			next++
+			processed++
+
+			c.Total++
+			if r.hasASN {
+				asnCounts[r.asn]++
+			}
+			if r.diff != nil {
+				c.Differences++
+				diffs = append(diffs, *r.diff)
+			}
+
+			if progress != nil && time.Since(lastReport) >= time.Second {
+				reportProgress(progress, processed, totalRows, start)
+				lastReport = time.Now()
+			}
+		}
+	}
+
+	if parseErr != nil {
+		return nil, nil, nil, parseErr
+	}
+
+	if progress != nil {
+		reportProgress(progress, processed, totalRows, start)
+	}
+
+	return c, diffs, asnCounts, nil
+}
+
+// lookupRow performs the MMDB lookups for a single geofeed row. It's called
+// concurrently from the worker pool and touches no shared state.
+func lookupRow(job rowJob, cityReader, asnReader mmdbReader, laxMode bool) rowResult {
+	prefix := strings.TrimSpace(job.row[0])
+	_, network, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return rowResult{lineNumber: job.lineNumber, err: fmt.Errorf("line %d: invalid prefix %q: %w", job.lineNumber, prefix, err)}
+	}
+
+	var record cityRecord
+	if err := cityReader.Lookup(network.IP, &record); err != nil {
+		return rowResult{lineNumber: job.lineNumber, err: fmt.Errorf("looking up %s: %w", prefix, err)}
+	}
+
+	res := rowResult{lineNumber: job.lineNumber}
+	diff := diffRow(job.lineNumber, job.row, laxMode, &record)
+
+	if asnReader != nil {
+		var asnRec asnRecord
+		if err := asnReader.Lookup(network.IP, &asnRec); err != nil {
+			return rowResult{lineNumber: job.lineNumber, err: fmt.Errorf("looking up ASN for %s: %w", prefix, err)}
+		}
+		res.asn = asnRec.AutonomousSystemNumber
+		res.hasASN = true
+		if diff != nil {
+			diff.ASN = asnRec.AutonomousSystemNumber
+			diff.ASNOrg = asnRec.AutonomousSystemOrganization
+		}
+	}
+
+	res.diff = diff
+	return res
+}
+
+// countRows does a quick line count of r to size a progress ETA. It's an
+// approximation: a geofeed field is not expected to contain embedded
+// newlines, but if one did, this would overcount.
+func countRows(r io.Reader) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	n := 0
+	for scanner.Scan() {
+		n++
+	}
+	return n, scanner.Err()
+}
+
+// reportProgress writes one throughput line to w.
+func reportProgress(w io.Writer, processed, total int, start time.Time) {
+	elapsed := time.Since(start)
+	rate := float64(processed) / elapsed.Seconds()
+
+	if total <= 0 {
+		fmt.Fprintf(w, "%d rows (%.0f rows/sec)\n", processed, rate)
+		return
+	}
+
+	var eta time.Duration
+	if rate > 0 {
+		eta = (time.Duration(float64(total-processed)/rate) * time.Second).Round(time.Second)
+	}
+	fmt.Fprintf(w, "%d/%d rows (%.0f rows/sec, ETA %s)\n", processed, total, rate, eta)
+}
+
+// PatchRecord is one row of an "expected corrections" patch: a geofeed
+// prefix whose reported location disagreed with the MMDB, expressed using
+// the MMDB's own values so it can be resubmitted as a correction.
+type PatchRecord struct {
+	Network string `json:"network" csv:"network"`
+	Country string `json:"country" csv:"country"`
+	Region  string `json:"region" csv:"region"`
+	City    string `json:"city" csv:"city"`
+	Postal  string `json:"postal" csv:"postal"`
+}
+
+// BuildPatch turns diffs into the "expected corrections" patch: one
+// PatchRecord per disagreeing row, using the MMDB's values rather than the
+// geofeed's.
+func BuildPatch(diffs []DiffRecord) []PatchRecord {
+	patch := make([]PatchRecord, len(diffs))
+	for i, d := range diffs {
+		patch[i] = PatchRecord{
+			Network: d.Prefix,
+			Country: d.ExpectedCountry,
+			Region:  d.ExpectedRegion,
+			City:    d.ExpectedCity,
+			Postal:  d.ExpectedPostal,
+		}
+	}
+	return patch
+}
+
+// AgreedPrefixes returns the prefixes from allPrefixes (as returned by
+// ReadPrefixes, 1 entry per line in file order) whose row is not among
+// diffs, i.e. already agrees with the MMDB and doesn't need a correction.
+func AgreedPrefixes(allPrefixes []string, diffs []DiffRecord) []string {
+	disagreed := make(map[int]bool, len(diffs))
+	for _, d := range diffs {
+		disagreed[d.Line] = true
+	}
+
+	agreed := make([]string, 0, len(allPrefixes)-len(diffs))
+	for i, prefix := range allPrefixes {
+		if !disagreed[i+1] {
+			agreed = append(agreed, prefix)
+		}
+	}
+	return agreed
+}
+
+// ReadPrefixes returns the prefix column of every row in the geofeed file
+// at gf, in file order. It's used by the -rdap cross-check, which only
+// needs the prefixes, not a city/ASN comparison.
+func ReadPrefixes(gf string) ([]string, error) {
+	f, err := os.Open(gf)
+	if err != nil {
+		return nil, fmt.Errorf("opening geofeed %s: %w", gf, err)
+	}
+	defer f.Close()
+
+	var prefixes []string
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", gf, err)
+		}
+		if len(row) == 0 {
+			continue
+		}
+		prefixes = append(prefixes, strings.TrimSpace(row[0]))
+	}
+	return prefixes, nil
+}
+
+// openASNReader opens the MMDB at path and confirms it is a database type
+// we know carries an ASN, returning an error naming the actual type if not.
+func openASNReader(path string) (*maxminddb.Reader, error) {
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening ASN database %s: %w", path, err)
+	}
+
+	if !asnDatabaseTypes[reader.Metadata.DatabaseType] {
+		dbType := reader.Metadata.DatabaseType
+		reader.Close()
+		return nil, fmt.Errorf(
+			"%s is a %s database; expected GeoLite2-ASN or GeoIP2-ISP",
+			path,
+			dbType,
+		)
+	}
+
+	return reader, nil
+}
+
+// diffRow compares a single geofeed row against the city record MaxMind has
+// for its prefix, returning a DiffRecord describing the disagreement, or
+// nil if they agree.
+func diffRow(lineNumber int, row []string, laxMode bool, record *cityRecord) *DiffRecord {
+	country := field(row, 1)
+	region := field(row, 2)
+	city := field(row, 3)
+	postal := field(row, 4)
+
+	expectedCountry := record.Country.IsoCode
+	expectedRegionCode := ""
+	if len(record.Subdivisions) > 0 {
+		expectedRegionCode = record.Subdivisions[0].IsoCode
+	}
+	expectedCity := record.City.Names["en"]
+	expectedPostal := record.Postal.Code
+
+	// Non-lax mode expects the full "US-NY" form; lax mode also accepts
+	// the bare subdivision code.
+	expectedRegion := expectedRegionCode
+	gotRegion := region
+	if !laxMode && expectedRegionCode != "" {
+		expectedRegion = expectedCountry + "-" + expectedRegionCode
+	}
+	if laxMode {
+		gotRegion = strings.TrimPrefix(gotRegion, country+"-")
+	}
+
+	var reasons []string
+	if country != expectedCountry {
+		reasons = append(reasons, "country mismatch")
+	}
+	if gotRegion != expectedRegion {
+		reasons = append(reasons, "region mismatch")
+	}
+	if city != "" && city != expectedCity {
+		reasons = append(reasons, "city mismatch")
+	}
+	if postal != "" && postal != expectedPostal {
+		reasons = append(reasons, "postal mismatch")
+	}
+
+	if len(reasons) == 0 {
+		return nil
+	}
+
+	return &DiffRecord{
+		Line:            lineNumber,
+		Prefix:          row[0],
+		Country:         country,
+		Region:          region,
+		City:            city,
+		Postal:          postal,
+		ExpectedCountry: expectedCountry,
+		ExpectedRegion:  expectedRegion,
+		ExpectedCity:    expectedCity,
+		ExpectedPostal:  expectedPostal,
+		Reason:          strings.Join(reasons, ", "),
+	}
+}
+
+// field returns row[i], or "" if the row is too short to have it.
+func field(row []string, i int) string {
+	if i >= len(row) {
+		return ""
+	}
+	return strings.TrimSpace(row[i])
+}